@@ -1,26 +1,159 @@
 package gps
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/mitre/fusera/retry"
+
 	"github.com/pkg/errors"
 )
 
+const (
+	awsTokenURL    = "http://169.254.169.254/latest/api/token"
+	awsDocumentURL = "http://169.254.169.254/latest/dynamic/instance-identity/document"
+	awsPkcs7URL    = "http://169.254.169.254/latest/dynamic/instance-identity/pkcs7"
+
+	awsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	awsTokenHeader    = "X-aws-ec2-metadata-token"
+	awsTokenTTL       = "21600"
+)
+
+// errImdsv2Unsupported indicates the IMDSv2 token endpoint rejected the
+// request, meaning the instance only speaks IMDSv1 (or has its metadata
+// hop limit set to 1). Callers fall back to an unauthenticated request.
+var errImdsv2Unsupported = errors.New("imdsv2 token endpoint unavailable")
+
+// metadataClient is shared by every cloud metadata probe (AWS IMDS, GCP
+// metadata server) so repeated calls don't each pay for their own dialer
+// and connection pool.
+var metadataClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   1 * time.Second,
+			KeepAlive: 1 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          1000,
+		MaxIdleConnsPerHost:   1000,
+		IdleConnTimeout:       500 * time.Millisecond,
+		TLSHandshakeTimeout:   500 * time.Millisecond,
+		ExpectContinueTimeout: 500 * time.Millisecond,
+	},
+}
+
+// azureMetadataClient talks to the Azure Instance Metadata Service, which
+// must be reached directly: it refuses requests that arrive through a
+// proxy, so this client can't share metadataClient's transport.
+var azureMetadataClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   1 * time.Second,
+			KeepAlive: 1 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          1000,
+		MaxIdleConnsPerHost:   1000,
+		IdleConnTimeout:       500 * time.Millisecond,
+		TLSHandshakeTimeout:   500 * time.Millisecond,
+		ExpectContinueTimeout: 500 * time.Millisecond,
+	},
+}
+
 // Locator Interface that describes everything needed to describe a location for the SDL API.
 type Locator interface {
 	SdlCloudName() string
-	Region() (string, error)
-	Locality() string
+	Region(ctx context.Context) (string, error)
+	Locality(ctx context.Context) string
 	LocalityType() string
 }
 
+// cachedToken holds a bearer token (typically a JWT) alongside when it
+// should be refreshed, so Locality doesn't round-trip to the metadata
+// service on every SDL call.
+type cachedToken struct {
+	mu     sync.Mutex
+	value  string
+	expiry time.Time
+}
+
+// get returns the cached token if it's still fresh, otherwise calls fetch
+// and caches the result. A fetch failure falls back to serving the stale
+// token (if any) rather than returning nothing.
+func (c *cachedToken) get(ctx context.Context, fetch func(context.Context) (string, error)) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.value != "" && time.Now().Before(c.expiry) {
+		return c.value
+	}
+	token, err := fetch(ctx)
+	if err != nil {
+		return c.value
+	}
+	c.value = token
+	c.expiry = tokenExpiry(token)
+	return c.value
+}
+
+// tokenExpiry returns when a token should be refreshed: shortly before its
+// "exp" claim for an actual JWT, or 24 hours from now for an opaque token
+// (e.g. the AWS pkcs7 document) or a JWT without a readable "exp" claim,
+// since those don't carry an expiration.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Now().Add(24 * time.Hour)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Now().Add(24 * time.Hour)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Now().Add(24 * time.Hour)
+	}
+	return time.Unix(claims.Exp, 0).Add(-30 * time.Second)
+}
+
+// cachedRegion memoizes a Locator's resolved region, since the cloud
+// region a process runs in never changes after start-up. A failed
+// resolution isn't cached, so Region can be retried on the next call.
+type cachedRegion struct {
+	mu    sync.Mutex
+	value string
+}
+
+func (c *cachedRegion) get(ctx context.Context, resolve func(context.Context) (string, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.value != "" {
+		return c.value, nil
+	}
+	region, err := resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.value = region
+	return c.value, nil
+}
+
 // GcpLocation A location for GCP environment.
-type GcpLocation struct{}
+type GcpLocation struct {
+	token  cachedToken
+	region cachedRegion
+}
 
 // SdlCloudName Returns gs, the proper string SDL associates with GCP.
 func (g *GcpLocation) SdlCloudName() string {
@@ -28,21 +161,13 @@ func (g *GcpLocation) SdlCloudName() string {
 }
 
 // Region Returns the sublocation of the cloud platform the current server is running on.
-func (g *GcpLocation) Region() (string, error) {
-	region, err := resolveGcpZone()
-	if err != nil {
-		return "", err
-	}
-	return region, nil
+func (g *GcpLocation) Region(ctx context.Context) (string, error) {
+	return g.region.get(ctx, resolveGcpZone)
 }
 
 // Locality Returns the locality for GCP environment.
-func (g *GcpLocation) Locality() string {
-	token, err := retrieveGCPInstanceToken()
-	if err != nil {
-		return ""
-	}
-	return string(token)
+func (g *GcpLocation) Locality(ctx context.Context) string {
+	return g.token.get(ctx, retrieveGCPInstanceToken)
 }
 
 // LocalityType Returns the locality-type for GCP environment.
@@ -51,7 +176,10 @@ func (g *GcpLocation) LocalityType() string {
 }
 
 // AwsLocation A location for AWS environment.
-type AwsLocation struct{}
+type AwsLocation struct {
+	pkcs7  cachedToken
+	region cachedRegion
+}
 
 // SdlCloudName Returns s3, the proper string SDL associates with AWS.
 func (a *AwsLocation) SdlCloudName() string {
@@ -59,17 +187,14 @@ func (a *AwsLocation) SdlCloudName() string {
 }
 
 // Region Returns the sublocation of the cloud platform the current server is running on.
-func (a *AwsLocation) Region() (string, error) {
-	region, err := resolveAwsRegion()
-	if err != nil {
-		return "", err
-	}
-	return region, nil
+func (a *AwsLocation) Region(ctx context.Context) (string, error) {
+	return a.region.get(ctx, resolveAwsRegion)
 }
 
-// Locality Returns the locality for AWS environment. //TODO: Implement
-func (a *AwsLocation) Locality() string {
-	return ""
+// Locality Returns the pkcs7 instance-identity signature for AWS environment,
+// fetched through the same IMDSv2 token flow used by Region.
+func (a *AwsLocation) Locality(ctx context.Context) string {
+	return a.pkcs7.get(ctx, resolveAwsPkcs7)
 }
 
 // LocalityType Returns the locality-type for AWS environment.
@@ -77,6 +202,36 @@ func (a *AwsLocation) LocalityType() string {
 	return "aws_pkcs7"
 }
 
+// sdlCloudAzure is the SDL cloud identifier used for Azure locations.
+// TODO: update once SDL assigns Azure a permanent identifier.
+const sdlCloudAzure = "azure"
+
+// AzureLocation A location for an Azure environment.
+type AzureLocation struct {
+	token  cachedToken
+	region cachedRegion
+}
+
+// SdlCloudName Returns the SDL cloud identifier associated with Azure.
+func (z *AzureLocation) SdlCloudName() string {
+	return sdlCloudAzure
+}
+
+// Region Returns the sublocation of the cloud platform the current server is running on.
+func (z *AzureLocation) Region(ctx context.Context) (string, error) {
+	return z.region.get(ctx, resolveAzureLocation)
+}
+
+// Locality Returns the attested-data JWT for Azure environment.
+func (z *AzureLocation) Locality(ctx context.Context) string {
+	return z.token.get(ctx, retrieveAzureInstanceToken)
+}
+
+// LocalityType Returns the locality-type for Azure environment.
+func (z *AzureLocation) LocalityType() string {
+	return "azure_jwt"
+}
+
 // TODO: try to be more siphisticated in figuring out if location is ncbi or follows cloud.region format
 
 // ManualLocation A location for a manual environment.
@@ -90,12 +245,12 @@ func (m *ManualLocation) SdlCloudName() string {
 }
 
 // Region Returns the sublocation of the cloud platform the current server is running on.
-func (m *ManualLocation) Region() (string, error) {
+func (m *ManualLocation) Region(ctx context.Context) (string, error) {
 	return m.locality, nil
 }
 
 // Locality Returns the locality for a manual environment.
-func (m *ManualLocation) Locality() string {
+func (m *ManualLocation) Locality(ctx context.Context) string {
 	return m.locality
 }
 
@@ -109,21 +264,105 @@ func NewManualLocation(location string) (*ManualLocation, error) {
 	return &ManualLocation{locality: location}, nil
 }
 
-// GenerateLocator Determines which locator to use by attempting to detect what cloud platform it is running on.
-func GenerateLocator() (Locator, error) {
-	_, err := resolveAwsRegion()
-	if err != nil {
-		// could be on google
-		// retain aws error message
-		msg := err.Error()
-		_, err := retrieveGCPInstanceToken()
-		if err != nil {
-			// return both aws and google error messages
-			return nil, errors.Wrap(err, msg)
+// probeTimeout bounds how long GenerateLocator waits on any single cloud's
+// metadata service before considering that probe a failure.
+const probeTimeout = 2 * time.Second
+
+// locatorProbe pairs a cloud's name with the check GenerateLocator uses to
+// detect it, so adding a cloud only means appending to the probes slice.
+type locatorProbe struct {
+	name  string
+	probe func(ctx context.Context) (Locator, error)
+}
+
+var locatorProbes = []locatorProbe{
+	{name: "aws", probe: func(ctx context.Context) (Locator, error) {
+		if _, err := resolveAwsRegion(ctx); err != nil {
+			return nil, err
+		}
+		return &AwsLocation{}, nil
+	}},
+	{name: "gcp", probe: func(ctx context.Context) (Locator, error) {
+		if _, err := retrieveGCPInstanceToken(ctx); err != nil {
+			return nil, err
 		}
 		return &GcpLocation{}, nil
+	}},
+	{name: "azure", probe: func(ctx context.Context) (Locator, error) {
+		if _, err := resolveAzureLocation(ctx); err != nil {
+			return nil, err
+		}
+		return &AzureLocation{}, nil
+	}},
+}
+
+var (
+	cachedLocatorMu  sync.Mutex
+	cachedLocatorVal Locator
+)
+
+// GenerateLocator Determines which locator to use by probing every
+// supported cloud's metadata service in parallel, each bounded by
+// probeTimeout, and returning the first one to answer successfully. If
+// every probe fails, the returned error lists what each cloud reported.
+// Only a successful resolution is cached for the life of the process,
+// since the cloud/region fusera runs on doesn't change after start-up --
+// a failure (a metadata blip, a cancelled ctx on the first call) isn't
+// cached, so the next call tries again instead of being poisoned forever.
+func GenerateLocator(ctx context.Context) (Locator, error) {
+	cachedLocatorMu.Lock()
+	defer cachedLocatorMu.Unlock()
+	if cachedLocatorVal != nil {
+		return cachedLocatorVal, nil
+	}
+	loc, err := generateLocator(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return &AwsLocation{}, nil
+	cachedLocatorVal = loc
+	return cachedLocatorVal, nil
+}
+
+func generateLocator(ctx context.Context) (Locator, error) {
+	type outcome struct {
+		name string
+		loc  Locator
+		err  error
+	}
+	results := make(chan outcome, len(locatorProbes))
+	for _, p := range locatorProbes {
+		p := p
+		go func() {
+			probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			done := make(chan outcome, 1)
+			go func() {
+				loc, err := p.probe(probeCtx)
+				done <- outcome{name: p.name, loc: loc, err: err}
+			}()
+			select {
+			case o := <-done:
+				results <- o
+			case <-probeCtx.Done():
+				results <- outcome{name: p.name, err: errors.Errorf("timed out after %s", probeTimeout)}
+			}
+		}()
+	}
+
+	errs := make(map[string]error, len(locatorProbes))
+	for i := 0; i < len(locatorProbes); i++ {
+		o := <-results
+		if o.err == nil {
+			return o.loc, nil
+		}
+		errs[o.name] = o.err
+	}
+
+	reasons := make([]string, len(locatorProbes))
+	for i, p := range locatorProbes {
+		reasons[i] = p.name + ": " + errs[p.name].Error()
+	}
+	return nil, errors.Errorf("fusera was not given a location and could not detect one; tried %s", strings.Join(reasons, "; "))
 }
 
 // ResolveTraditionalLocation Forms the traditional location string.
@@ -188,38 +427,129 @@ func GenerateLocator() (Locator, error) {
 // 	return platform, nil
 // }
 
-func resolveAwsRegion() (string, error) {
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   1 * time.Second,
-				KeepAlive: 1 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:          1000,
-			MaxIdleConnsPerHost:   1000,
-			IdleConnTimeout:       500 * time.Millisecond,
-			TLSHandshakeTimeout:   500 * time.Millisecond,
-			ExpectContinueTimeout: 500 * time.Millisecond,
-		},
+// fetchAwsMetadataToken requests an IMDSv2 session token. Callers fall back
+// to an unauthenticated IMDSv1 request when the token endpoint reports it
+// isn't available (see errImdsv2Unsupported). It makes a single attempt and
+// returns a retriable error on transient failure -- awsMetadataGet is only
+// ever called from inside another retry.Do loop, and retrying here too
+// would compound into MaxAttempts^2 attempts against a persistently
+// failing token endpoint.
+func fetchAwsMetadataToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, awsTokenURL, nil)
+	if err != nil {
+		return "", err
 	}
-	// maybe we are on an AWS instance and can resolve what region we are in.
-	// let's try it out and if we timeout we'll return an error.
-	// use this url: http://169.254.169.254/latest/dynamic/instance-identity/document
-	resp, err := client.Get("http://169.254.169.254/latest/dynamic/instance-identity/document")
+	req.Header.Add(awsTokenTTLHeader, awsTokenTTL)
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return "", retry.Transient(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound {
+		return "", errImdsv2Unsupported
+	}
+	if err := retry.CheckHTTPStatus(resp); err != nil {
+		return "", errors.Wrapf(err, "issue trying to retrieve IMDSv2 token")
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.New("issue trying to retrieve IMDSv2 token, couldn't read response from amazon")
+	}
+	return string(body), nil
+}
+
+// awsMetadataGet issues a GET against the AWS instance metadata service,
+// attaching an IMDSv2 token when the token endpoint serves one and falling
+// back to an unauthenticated IMDSv1 request otherwise.
+func awsMetadataGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return "", errors.Wrapf(err, "location was not provided, fusera attempted to resolve region but encountered an error, this feature only works when fusera is on an amazon or google instance")
+		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.Errorf("issue trying to resolve region, got: %d: %s", resp.StatusCode, resp.Status)
+	token, err := fetchAwsMetadataToken(ctx)
+	switch err {
+	case nil:
+		req.Header.Add(awsTokenHeader, token)
+	case errImdsv2Unsupported:
+		// older AMIs, and instances with the metadata hop limit set to 1,
+		// never serve a token; fall back to the unauthenticated v1 call.
+	default:
+		return nil, err
 	}
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, retry.Transient(err)
+	}
+	return resp, nil
+}
+
+// awsMetadataSource resolves an AWS region from some metadata source.
+// resolveAwsRegion tries each source in awsRegionSources in order until
+// one succeeds, so a new source (EKS Pod Identity, etc.) can be added
+// without touching AwsLocation or GenerateLocator.
+type awsMetadataSource interface {
+	Region(ctx context.Context) (string, error)
+}
+
+// imdsSource resolves the region from the EC2 instance metadata service at
+// 169.254.169.254.
+type imdsSource struct{}
+
+func (imdsSource) Region(ctx context.Context) (string, error) {
+	return resolveAwsRegionIMDS(ctx)
+}
+
+// ecsTaskSource resolves the region from the ECS/Fargate task metadata
+// endpoint, used when the instance metadata service isn't reachable.
+type ecsTaskSource struct{}
+
+func (ecsTaskSource) Region(ctx context.Context) (string, error) {
+	return resolveAwsRegionECS(ctx)
+}
+
+var awsRegionSources = []awsMetadataSource{
+	imdsSource{},
+	ecsTaskSource{},
+}
+
+// resolveAwsRegion tries each of awsRegionSources in order, returning the
+// first region any of them resolves. EC2 IMDS is tried first; ECS
+// task metadata is a fallback for containers that can't reach
+// 169.254.169.254 at all.
+func resolveAwsRegion(ctx context.Context) (string, error) {
+	var errs []string
+	for _, src := range awsRegionSources {
+		region, err := src.Region(ctx)
+		if err == nil {
+			return region, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return "", errors.New(strings.Join(errs, "; "))
+}
+
+func resolveAwsRegionIMDS(ctx context.Context) (string, error) {
+	// maybe we are on an AWS instance and can resolve what region we are in.
+	// let's try it out and if we timeout we'll return an error.
 	var payload struct {
 		Region string `json:"region"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&payload)
+	err := retry.Do(ctx, retry.DefaultConfig, func() error {
+		resp, err := awsMetadataGet(ctx, awsDocumentURL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := retry.CheckHTTPStatus(resp); err != nil {
+			return errors.Wrapf(err, "issue trying to resolve region")
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			return errors.New("issue trying to resolve region, couldn't decode response from amazon")
+		}
+		return nil
+	})
 	if err != nil {
-		return "", errors.New("issue trying to resolve region, couldn't decode response from amazon")
+		return "", errors.Wrapf(err, "location was not provided, fusera attempted to resolve region but encountered an error, this feature only works when fusera is on an amazon, google, or azure instance")
 	}
 	if payload.Region == "" {
 		return "", errors.New("issue trying to resolve region, amazon returned empty region")
@@ -227,72 +557,222 @@ func resolveAwsRegion() (string, error) {
 	return payload.Region, nil
 }
 
-func resolveGcpZone() (string, error) {
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   1 * time.Second,
-				KeepAlive: 1 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:          1000,
-			MaxIdleConnsPerHost:   1000,
-			IdleConnTimeout:       500 * time.Millisecond,
-			TLSHandshakeTimeout:   500 * time.Millisecond,
-			ExpectContinueTimeout: 500 * time.Millisecond,
-		},
-	}
-	req, err := http.NewRequest("GET", "http://metadata.google.internal/computeMetadata/v1/instance/zone?alt=json", nil)
-	req.Header.Add("Metadata-Flavor", "Google")
-	resp, err := client.Do(req)
+// resolveAwsPkcs7 fetches the pkcs7 instance-identity signature used as the
+// aws_pkcs7 locality document, through the same IMDSv2 token flow as
+// resolveAwsRegion.
+func resolveAwsPkcs7(ctx context.Context) (string, error) {
+	var doc string
+	err := retry.Do(ctx, retry.DefaultConfig, func() error {
+		resp, err := awsMetadataGet(ctx, awsPkcs7URL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := retry.CheckHTTPStatus(resp); err != nil {
+			return errors.Wrapf(err, "issue trying to retrieve pkcs7 signature")
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.New("issue trying to retrieve pkcs7 signature, couldn't read response from amazon")
+		}
+		doc = string(body)
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "issue trying to retrieve pkcs7 signature from amazon")
+	}
+	return doc, nil
+}
+
+const (
+	ecsMetadataURIEnvV4 = "ECS_CONTAINER_METADATA_URI_V4"
+	ecsMetadataURIEnvV3 = "ECS_CONTAINER_METADATA_URI"
+)
+
+// resolveAwsRegionECS resolves the region from the ECS/Fargate task
+// metadata endpoint. It's used as a fallback when 169.254.169.254 is
+// unreachable, which is the case inside an ECS task or a Fargate container.
+func resolveAwsRegionECS(ctx context.Context) (string, error) {
+	uri := os.Getenv(ecsMetadataURIEnvV4)
+	if uri == "" {
+		uri = os.Getenv(ecsMetadataURIEnvV3)
+	}
+	if uri == "" {
+		return "", errors.New("ECS task metadata endpoint not configured, ECS_CONTAINER_METADATA_URI_V4 is not set")
+	}
+	var payload struct {
+		TaskARN          string `json:"TaskARN"`
+		AvailabilityZone string `json:"AvailabilityZone"`
+	}
+	err := retry.Do(ctx, retry.DefaultConfig, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri+"/task", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := metadataClient.Do(req)
+		if err != nil {
+			return retry.Transient(err)
+		}
+		defer resp.Body.Close()
+		if err := retry.CheckHTTPStatus(resp); err != nil {
+			return errors.Wrapf(err, "issue trying to resolve region from ECS task metadata")
+		}
+		return json.NewDecoder(resp.Body).Decode(&payload)
+	})
 	if err != nil {
-		return "", errors.Wrapf(err, "location was not provided, fusera attempted to resolve region but encountered an error, this feature only works when fusera is on an amazon or google instance")
+		return "", errors.Wrapf(err, "issue trying to resolve region from ECS task metadata")
 	}
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.Errorf("issue trying to resolve region, got: %d: %s", resp.StatusCode, resp.Status)
+	if region := regionFromTaskARN(payload.TaskARN); region != "" {
+		return region, nil
 	}
-	var payload string
-	err = json.NewDecoder(resp.Body).Decode(&payload)
+	if payload.AvailabilityZone != "" {
+		return strings.TrimRight(payload.AvailabilityZone, "abcdefghijklmnopqrstuvwxyz"), nil
+	}
+	return "", errors.New("issue trying to resolve region, ECS task metadata returned neither a TaskARN nor an AvailabilityZone")
+}
+
+// regionFromTaskARN extracts the region component from an ECS task ARN,
+// e.g. "arn:aws:ecs:us-east-1:123456789012:task/..." -> "us-east-1".
+// Returns "" if arn doesn't look like a task ARN.
+func regionFromTaskARN(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 4 || parts[0] != "arn" || parts[2] != "ecs" {
+		return ""
+	}
+	return parts[3]
+}
+
+func resolveGcpZone(ctx context.Context) (string, error) {
+	var path string
+	err := retry.Do(ctx, retry.DefaultConfig, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", "http://metadata.google.internal/computeMetadata/v1/instance/zone?alt=json", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Add("Metadata-Flavor", "Google")
+		resp, err := metadataClient.Do(req)
+		if err != nil {
+			return retry.Transient(err)
+		}
+		defer resp.Body.Close()
+		if err := retry.CheckHTTPStatus(resp); err != nil {
+			return errors.Wrapf(err, "issue trying to resolve region")
+		}
+		var payload string
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			return errors.New("issue trying to resolve region, couldn't decode response from google")
+		}
+		path = filepath.Base(payload)
+		return nil
+	})
 	if err != nil {
-		return "", errors.New("issue trying to resolve region, couldn't decode response from google")
+		return "", errors.Wrapf(err, "location was not provided, fusera attempted to resolve region but encountered an error, this feature only works when fusera is on an amazon, google, or azure instance")
 	}
-	path := filepath.Base(payload)
 	if path == "" || len(path) == 1 {
 		return "", errors.New("issue trying to resolve region, google returned empty region")
 	}
 	return path, nil
 }
 
-func retrieveGCPInstanceToken() ([]byte, error) {
-	// make a request to token endpoint
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   1 * time.Second,
-				KeepAlive: 1 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:          1000,
-			MaxIdleConnsPerHost:   1000,
-			IdleConnTimeout:       500 * time.Millisecond,
-			TLSHandshakeTimeout:   500 * time.Millisecond,
-			ExpectContinueTimeout: 500 * time.Millisecond,
-		},
-	}
-	req, err := http.NewRequest("GET", "http://metadata/computeMetadata/v1/instance/service-accounts/default/identity?audience=https://www.ncbi.nlm.nih.gov&format=full", nil)
-	req.Header.Add("Metadata-Flavor", "Google")
-	resp, err := client.Do(req)
+const (
+	azureMetadataHeader = "Metadata"
+	azureInstanceURL    = "http://169.254.169.254/metadata/instance?api-version=2021-02-01"
+	azureTokenURL       = "http://169.254.169.254/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https://www.ncbi.nlm.nih.gov"
+)
+
+func resolveAzureLocation(ctx context.Context) (string, error) {
+	var location string
+	err := retry.Do(ctx, retry.DefaultConfig, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureInstanceURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Add(azureMetadataHeader, "true")
+		resp, err := azureMetadataClient.Do(req)
+		if err != nil {
+			return retry.Transient(err)
+		}
+		defer resp.Body.Close()
+		if err := retry.CheckHTTPStatus(resp); err != nil {
+			return errors.Wrapf(err, "issue trying to resolve region")
+		}
+		var payload struct {
+			Compute struct {
+				Location string `json:"location"`
+			} `json:"compute"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			return errors.New("issue trying to resolve region, couldn't decode response from azure")
+		}
+		location = payload.Compute.Location
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "location was not provided, fusera attempted to resolve region but encountered an error, this feature only works when fusera is on an amazon or google instance")
+		return "", errors.Wrapf(err, "location was not provided, fusera attempted to resolve region but encountered an error, this feature only works when fusera is on an amazon, google, or azure instance")
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("issue trying to retreive GCP instance token, got: %d: %s", resp.StatusCode, resp.Status)
+	if location == "" {
+		return "", errors.New("issue trying to resolve region, azure returned empty region")
 	}
-	token, err := ioutil.ReadAll(resp.Body)
+	return location, nil
+}
+
+func retrieveAzureInstanceToken(ctx context.Context) (string, error) {
+	var token string
+	err := retry.Do(ctx, retry.DefaultConfig, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureTokenURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Add(azureMetadataHeader, "true")
+		resp, err := azureMetadataClient.Do(req)
+		if err != nil {
+			return retry.Transient(err)
+		}
+		defer resp.Body.Close()
+		if err := retry.CheckHTTPStatus(resp); err != nil {
+			return errors.Wrapf(err, "issue trying to retrieve azure instance token")
+		}
+		var payload struct {
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			return errors.New("issue trying to retrieve azure instance token, couldn't decode response from azure")
+		}
+		token = payload.AccessToken
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func retrieveGCPInstanceToken(ctx context.Context) (string, error) {
+	var token string
+	err := retry.Do(ctx, retry.DefaultConfig, func() error {
+		// make a request to token endpoint
+		req, err := http.NewRequestWithContext(ctx, "GET", "http://metadata/computeMetadata/v1/instance/service-accounts/default/identity?audience=https://www.ncbi.nlm.nih.gov&format=full", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Add("Metadata-Flavor", "Google")
+		resp, err := metadataClient.Do(req)
+		if err != nil {
+			return retry.Transient(err)
+		}
+		defer resp.Body.Close()
+		if err := retry.CheckHTTPStatus(resp); err != nil {
+			return errors.Wrapf(err, "issue trying to retreive GCP instance token")
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.New("issue trying to resolve region, couldn't decode response from google")
+		}
+		token = string(body)
+		return nil
+	})
 	if err != nil {
-		return nil, errors.New("issue trying to resolve region, couldn't decode response from google")
+		return "", errors.Wrapf(err, "location was not provided, fusera attempted to resolve region but encountered an error, this feature only works when fusera is on an amazon, google, or azure instance")
 	}
 	return token, nil
 }
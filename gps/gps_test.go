@@ -0,0 +1,94 @@
+package gps
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// jwtWithExp builds a minimal (unsigned, header left empty) three-part JWT
+// carrying the given "exp" claim, enough for tokenExpiry to parse.
+func jwtWithExp(exp int64) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp)))
+	return "header." + payload + ".signature"
+}
+
+func TestRegionFromTaskARN(t *testing.T) {
+	tests := []struct {
+		name string
+		arn  string
+		want string
+	}{
+		{
+			name: "task arn with region",
+			arn:  "arn:aws:ecs:us-east-1:123456789012:task/my-cluster/1234567890abcdef",
+			want: "us-east-1",
+		},
+		{
+			name: "task arn with a different region",
+			arn:  "arn:aws:ecs:eu-west-2:123456789012:task/my-cluster/1234567890abcdef",
+			want: "eu-west-2",
+		},
+		{
+			name: "empty arn",
+			arn:  "",
+			want: "",
+		},
+		{
+			name: "too few colon-separated parts",
+			arn:  "arn:aws:ecs",
+			want: "",
+		},
+		{
+			name: "not an arn at all",
+			arn:  "not-an-arn",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := regionFromTaskARN(tt.arn); got != tt.want {
+				t.Errorf("regionFromTaskARN(%q) = %q, want %q", tt.arn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	const tolerance = 2 * time.Second
+
+	t.Run("JWT with an exp claim expires 30s before it", func(t *testing.T) {
+		exp := time.Now().Add(1 * time.Hour).Unix()
+		want := time.Unix(exp, 0).Add(-30 * time.Second)
+		got := tokenExpiry(jwtWithExp(exp))
+		if d := got.Sub(want); d < -tolerance || d > tolerance {
+			t.Errorf("tokenExpiry() = %s, want %s (+/- %s)", got, want, tolerance)
+		}
+	})
+
+	t.Run("JWT with no exp claim falls back to 24h", func(t *testing.T) {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+		got := tokenExpiry("header." + payload + ".signature")
+		want := time.Now().Add(24 * time.Hour)
+		if d := got.Sub(want); d < -tolerance || d > tolerance {
+			t.Errorf("tokenExpiry() = %s, want ~%s", got, want)
+		}
+	})
+
+	t.Run("JWT with unparseable payload falls back to 24h", func(t *testing.T) {
+		got := tokenExpiry("header.not-valid-base64!!!.signature")
+		want := time.Now().Add(24 * time.Hour)
+		if d := got.Sub(want); d < -tolerance || d > tolerance {
+			t.Errorf("tokenExpiry() = %s, want ~%s", got, want)
+		}
+	})
+
+	t.Run("opaque token (e.g. pkcs7) falls back to 24h", func(t *testing.T) {
+		got := tokenExpiry("not-a-jwt-at-all")
+		want := time.Now().Add(24 * time.Hour)
+		if d := got.Sub(want); d < -tolerance || d > tolerance {
+			t.Errorf("tokenExpiry() = %s, want ~%s", got, want)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+// Package retry provides a small retry helper for the transient failures
+// fusera runs into talking to the SDL API and cloud metadata services: a
+// momentary IMDS blip or a 500/429/503 from SDL shouldn't abort a mount.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config controls how Do paces its retries.
+type Config struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultConfig is a sensible default for network calls: four attempts,
+// backing off from 250ms up to a 5s cap.
+var DefaultConfig = Config{
+	MaxAttempts: 4,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// RetriableError marks an error as transient. After, when non-zero,
+// overrides the computed backoff for the next attempt (e.g. a Retry-After
+// header); a zero After falls back to Config's exponential backoff.
+type RetriableError struct {
+	Err   error
+	After time.Duration
+}
+
+func (r *RetriableError) Error() string { return r.Err.Error() }
+func (r *RetriableError) Unwrap() error { return r.Err }
+
+// Do runs fn, retrying with exponential backoff and jitter while fn
+// returns an error whose cause is a *RetriableError, up to
+// cfg.MaxAttempts. Any other error is returned immediately without
+// retrying. ctx cancellation aborts the retry loop between attempts.
+func Do(ctx context.Context, cfg Config, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < cfg.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := backoff(cfg, attempt, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		retriable, ok := asRetriable(err)
+		if !ok {
+			return err
+		}
+		err = retriable
+	}
+	return err
+}
+
+// causer is the interface github.com/pkg/errors' wrapped errors satisfy,
+// letting asRetriable see through an errors.Wrap/Wrapf call to the
+// *RetriableError underneath.
+type causer interface {
+	Cause() error
+}
+
+// asRetriable walks err's cause chain looking for a *RetriableError, so a
+// *RetriableError wrapped with errors.Wrap/Wrapf for context still retries.
+func asRetriable(err error) (*RetriableError, bool) {
+	for err != nil {
+		if r, ok := err.(*RetriableError); ok {
+			return r, true
+		}
+		c, ok := err.(causer)
+		if !ok {
+			return nil, false
+		}
+		err = c.Cause()
+	}
+	return nil, false
+}
+
+func backoff(cfg Config, attempt int, lastErr error) time.Duration {
+	if retriable, ok := lastErr.(*RetriableError); ok && retriable.After > 0 {
+		return retriable.After
+	}
+	d := cfg.BaseDelay * time.Duration(int64(1)<<uint(attempt-1))
+	if d > cfg.MaxDelay {
+		d = cfg.MaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(d) + 1))
+	return d/2 + jitter/2
+}
+
+// Transient marks err (typically a transport-level failure from
+// http.Client.Do, such as a one-second IMDS blip or a dropped connection)
+// as retriable.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetriableError{Err: err}
+}
+
+// CheckHTTPStatus turns a non-2xx response into an error. 429, 500, 502,
+// 503 and 504 responses are marked retriable -- a transient 500 from SDL
+// shouldn't abort the whole request -- honoring any Retry-After header on
+// 429/503. Every other non-2xx status is returned as a plain error.
+func CheckHTTPStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err := errors.Errorf("unexpected status: %d: %s", resp.StatusCode, resp.Status)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return &RetriableError{Err: err, After: retryAfter(resp)}
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return &RetriableError{Err: err}
+	default:
+		return err
+	}
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
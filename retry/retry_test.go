@@ -0,0 +1,141 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBackoff(t *testing.T) {
+	cfg := Config{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 1 * time.Second}
+
+	t.Run("respects Retry-After on the last error", func(t *testing.T) {
+		lastErr := &RetriableError{Err: errors.New("rate limited"), After: 3 * time.Second}
+		if got := backoff(cfg, 1, lastErr); got != 3*time.Second {
+			t.Errorf("backoff() = %s, want %s", got, 3*time.Second)
+		}
+	})
+
+	t.Run("grows exponentially and stays capped", func(t *testing.T) {
+		// attempt 1: d = BaseDelay * 2^0 = 100ms, result in [50ms, 100ms].
+		if got := backoff(cfg, 1, nil); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Errorf("backoff(attempt=1) = %s, want in [50ms, 100ms]", got)
+		}
+		// attempt 4: d = BaseDelay * 2^3 = 800ms, result in [400ms, 800ms].
+		if got := backoff(cfg, 4, nil); got < 400*time.Millisecond || got > 800*time.Millisecond {
+			t.Errorf("backoff(attempt=4) = %s, want in [400ms, 800ms]", got)
+		}
+		// attempt 10: d would be far past MaxDelay, so it's capped at 1s,
+		// result in [500ms, 1s].
+		if got := backoff(cfg, 10, nil); got < 500*time.Millisecond || got > 1*time.Second {
+			t.Errorf("backoff(attempt=10) = %s, want in [500ms, 1s]", got)
+		}
+	})
+}
+
+func TestAsRetriable(t *testing.T) {
+	retriable := &RetriableError{Err: errors.New("boom")}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bare retriable error", retriable, true},
+		{"wrapped once", errors.Wrap(retriable, "context"), true},
+		{"wrapped twice", errors.Wrapf(errors.Wrap(retriable, "inner"), "outer"), true},
+		{"plain error", errors.New("not retriable"), false},
+		{"wrapped plain error", errors.Wrap(errors.New("not retriable"), "context"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := asRetriable(tt.err)
+			if ok != tt.want {
+				t.Fatalf("asRetriable() ok = %v, want %v", ok, tt.want)
+			}
+			if ok && got != retriable {
+				t.Errorf("asRetriable() = %v, want %v", got, retriable)
+			}
+		})
+	}
+}
+
+func TestCheckHTTPStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		header        http.Header
+		wantErr       bool
+		wantRetriable bool
+	}{
+		{"200 OK", http.StatusOK, nil, false, false},
+		{"204 No Content", http.StatusNoContent, nil, false, false},
+		{"404 Not Found", http.StatusNotFound, nil, true, false},
+		{"429 Too Many Requests", http.StatusTooManyRequests, nil, true, true},
+		{"500 Internal Server Error", http.StatusInternalServerError, nil, true, true},
+		{"502 Bad Gateway", http.StatusBadGateway, nil, true, true},
+		{"503 Service Unavailable", http.StatusServiceUnavailable, nil, true, true},
+		{"504 Gateway Timeout", http.StatusGatewayTimeout, nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Header: tt.header}
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+			err := CheckHTTPStatus(resp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckHTTPStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			_, retriable := err.(*RetriableError)
+			if retriable != tt.wantRetriable {
+				t.Errorf("CheckHTTPStatus() retriable = %v, want %v", retriable, tt.wantRetriable)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"no header", "", 0},
+		{"seconds", "5", 5 * time.Second},
+		{"zero seconds", "0", 0},
+		{"not a number or date", "soon", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			if got := retryAfter(resp); got != tt.want {
+				t.Errorf("retryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("HTTP-date in the future", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{}}
+		future := time.Now().Add(1 * time.Hour)
+		resp.Header.Set("Retry-After", future.UTC().Format(http.TimeFormat))
+		got := retryAfter(resp)
+		if got <= 0 || got > 1*time.Hour {
+			t.Errorf("retryAfter() = %s, want a positive duration up to 1h", got)
+		}
+	})
+
+	t.Run("HTTP-date in the past", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{}}
+		past := time.Now().Add(-1 * time.Hour)
+		resp.Header.Set("Retry-After", past.UTC().Format(http.TimeFormat))
+		if got := retryAfter(resp); got != 0 {
+			t.Errorf("retryAfter() = %s, want 0 for a past date", got)
+		}
+	})
+}
@@ -1,15 +1,21 @@
 package sdl
 
 import (
+	"context"
 	"time"
 
 	"github.com/mitre/fusera/fuseralib"
+	"github.com/mitre/fusera/gps"
 
 	"github.com/mitre/fusera/info"
 
 	"github.com/pkg/errors"
 )
 
+// TODO: the client that fetches this payload from the SDL API (outside
+// this package) should wrap its request with retry.Do so a transient SDL
+// 500/429/503 doesn't abort the whole mount.
+
 // VersionWrap The JSON object that wraps the SDL API's responses.
 type VersionWrap struct {
 	Version string       `json:"version,omitempty"`
@@ -42,9 +48,15 @@ type Accession struct {
 // 1. Accession is one of the ones we asked for.
 // 2. Status should be an HTTP 200 OK.
 // 3. Files shouldn't be empty.
-// 4. It's not a duplicate accession (we should only get one of each accession).
+// 4. It's not a duplicate accession. When allowComplementaryDuplicates is
+//    set, a duplicate whose files don't overlap any already seen for that
+//    accession is let through instead -- SDL splits some accessions across
+//    storage tiers and returns one entry per tier. Default callers should
+//    pass false and keep the strict behavior; this is opt-in because a
+//    non-overlapping filename list doesn't prove the second entry isn't
+//    simply a bad response.
 // 5. All Files are valid.
-func (a *Accession) Validate(isDup map[string]bool) error {
+func (a *Accession) Validate(isDup map[string]bool, seenFiles map[string]map[string]bool, allowComplementaryDuplicates bool) error {
 	if !info.LookUpAccession(a.ID) {
 		return errors.Errorf("SDL API v%s returned accession that wasn't requested: %s", info.SdlVersion, a.ID)
 	}
@@ -55,9 +67,23 @@ func (a *Accession) Validate(isDup map[string]bool) error {
 		return errors.Errorf("SDL API v%s returned no files for accession %s", info.SdlVersion, a.ID)
 	}
 	if isDup[a.ID] {
-		return errors.Errorf("SDL API v%s returned a duplicate accession: %s", info.SdlVersion, a.ID)
+		if !allowComplementaryDuplicates {
+			return errors.Errorf("SDL API v%s returned a duplicate accession: %s", info.SdlVersion, a.ID)
+		}
+		prev := seenFiles[a.ID]
+		for i := range a.Files {
+			if prev[a.Files[i].Name] {
+				return errors.Errorf("SDL API v%s returned a duplicate accession: %s", info.SdlVersion, a.ID)
+			}
+		}
 	}
 	isDup[a.ID] = true
+	if seenFiles[a.ID] == nil {
+		seenFiles[a.ID] = map[string]bool{}
+	}
+	for i := range a.Files {
+		seenFiles[a.ID][a.Files[i].Name] = true
+	}
 
 	for i := range a.Files {
 		err := a.Files[i].Validate()
@@ -69,18 +95,22 @@ func (a *Accession) Validate(isDup map[string]bool) error {
 }
 
 // Transfigure Changes the SDL representation of an Accession into the Fusera representation.
-func (a *Accession) Transfigure() *fuseralib.Accession {
-	ff := mapFiles(a.Files)
+// ctx is threaded down to each File's Transfigure so a FUSE unmount can
+// cancel any in-flight locality lookups promptly instead of waiting out
+// the default HTTP timeouts. locator picks which of a File's Locations to
+// use when SDL returned more than one.
+func (a *Accession) Transfigure(ctx context.Context, locator gps.Locator) *fuseralib.Accession {
+	ff := mapFiles(ctx, a.Files, locator)
 	return &fuseralib.Accession{
 		ID:    a.ID,
 		Files: ff,
 	}
 }
 
-func mapFiles(ff []*File) map[string]fuseralib.File {
+func mapFiles(ctx context.Context, ff []*File, locator gps.Locator) map[string]fuseralib.File {
 	mf := map[string]fuseralib.File{}
 	for i := range ff {
-		mf[ff[i].Name] = ff[i].Transfigure()
+		mf[ff[i].Name] = ff[i].Transfigure(ctx, locator)
 	}
 	return mf
 }
@@ -92,14 +122,15 @@ type File struct {
 	Type         string     `json:"type,omitempty"`
 	ModifiedDate time.Time  `json:"modificationDate,omitempty"`
 	Md5Hash      string     `json:"md5,omitempty"`
-	Locations    []Location `json:"locations,omitempty`
+	Locations    []Location `json:"locations,omitempty"`
 }
 
 // Validate Files
 // 1. Files need a name.
 // 2. Files need a type.
-// 3. If there is a Location, there should only be one.
-// 4. If there is a Location, it should be valid.
+// 3. Every Location, if any, should be valid. SDL legitimately returns
+//    more than one when a file is mirrored across regions or clouds; which
+//    one to use is decided later, in Transfigure.
 func (f *File) Validate() error {
 	if f.Name == "" {
 		return errors.Errorf("SDL API v%s returned a file without a name", info.SdlVersion)
@@ -107,21 +138,24 @@ func (f *File) Validate() error {
 	if f.Type == "" {
 		return errors.Errorf("SDL API v%s returned a file without a type", info.SdlVersion)
 	}
-	if len(f.Locations) > 1 {
-		return errors.Errorf("SDL API v%s returned multiple locations for a file", info.SdlVersion)
-	}
-	if len(f.Locations) == 0 {
-		return nil
-	}
-	err := f.Locations[0].Validate()
-	if err != nil {
-		return err
+	for i := range f.Locations {
+		if err := f.Locations[i].Validate(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// Transfigure Changes the SDL representation of a File into the Fusera representation.
-func (f *File) Transfigure() fuseralib.File {
+// Transfigure Changes the SDL representation of a File into the Fusera representation,
+// picking whichever of f.Locations best matches where fusera is running.
+// newfile.ExpirationDate is the chosen Location's presigned-URL expiry,
+// carried into fuseralib.File so a background refresher in that package
+// can re-query SDL before the URL expires mid-read; fuseralib.File must
+// expose an ExpirationDate time.Time field to receive it. fuseralib lives
+// in its own module and isn't part of this checkout, so that field can't
+// be added here -- this assumes it already exists there, the same
+// assumption every other field on fuseralib.File below already makes.
+func (f *File) Transfigure(ctx context.Context, locator gps.Locator) fuseralib.File {
 	newfile := fuseralib.File{
 		Name:         f.Name,
 		Size:         f.Size,
@@ -129,15 +163,52 @@ func (f *File) Transfigure() fuseralib.File {
 		ModifiedDate: f.ModifiedDate,
 		Md5Hash:      f.Md5Hash,
 	}
-	if len(f.Locations) > 0 {
-		l := f.Locations[0]
+	l := selectLocation(ctx, f.Locations, locator)
+	if l != nil {
 		newfile.Link = l.Link
 		newfile.Service = l.Service
 		newfile.Region = l.Region
+		newfile.ExpirationDate = l.ExpirationDate
 	}
 	return newfile
 }
 
+// selectLocation picks the Location that best matches where fusera is
+// running: an exact cloud+region match first, then the same cloud in a
+// different region, then whatever location SDL listed first. A nil
+// locator, or a Locations without any cloud/region match, falls back to
+// the first location so single-location responses behave as before.
+func selectLocation(ctx context.Context, locations []Location, locator gps.Locator) *Location {
+	if len(locations) == 0 {
+		return nil
+	}
+	if locator == nil || len(locations) == 1 {
+		return &locations[0]
+	}
+	cloud := locator.SdlCloudName()
+	region, err := locator.Region(ctx)
+	if err != nil {
+		region = ""
+	}
+	var sameCloud *Location
+	for i := range locations {
+		l := &locations[i]
+		if l.Service != cloud {
+			continue
+		}
+		if region != "" && l.Region == region {
+			return l
+		}
+		if sameCloud == nil {
+			sameCloud = l
+		}
+	}
+	if sameCloud != nil {
+		return sameCloud
+	}
+	return &locations[0]
+}
+
 // Location The JSON object used by the SDL API to represent the location of a file.
 type Location struct {
 	Link           string    `json:"link,omitempty"`
@@ -0,0 +1,102 @@
+package sdl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mitre/fusera/gps"
+)
+
+// fakeLocator is a minimal gps.Locator double for exercising selectLocation
+// without touching any real cloud metadata service.
+type fakeLocator struct {
+	cloud     string
+	region    string
+	regionErr error
+}
+
+func (f *fakeLocator) SdlCloudName() string { return f.cloud }
+func (f *fakeLocator) Region(ctx context.Context) (string, error) {
+	return f.region, f.regionErr
+}
+func (f *fakeLocator) Locality(ctx context.Context) string { return "" }
+func (f *fakeLocator) LocalityType() string                { return "" }
+
+func TestSelectLocation(t *testing.T) {
+	s3UsEast1 := Location{Link: "s3-us-east-1", Service: "s3", Region: "us-east-1"}
+	s3UsWest2 := Location{Link: "s3-us-west-2", Service: "s3", Region: "us-west-2"}
+	gsUsEast1 := Location{Link: "gs-us-east-1", Service: "gs", Region: "us-east-1"}
+
+	tests := []struct {
+		name      string
+		locations []Location
+		locator   *fakeLocator
+		wantLink  string
+		wantNil   bool
+	}{
+		{
+			name:      "no locations",
+			locations: nil,
+			locator:   &fakeLocator{cloud: "s3", region: "us-east-1"},
+			wantNil:   true,
+		},
+		{
+			name:      "single location always wins, even on another cloud",
+			locations: []Location{gsUsEast1},
+			locator:   &fakeLocator{cloud: "s3", region: "us-east-1"},
+			wantLink:  gsUsEast1.Link,
+		},
+		{
+			name:      "nil locator falls back to the first location",
+			locations: []Location{s3UsWest2, s3UsEast1},
+			locator:   nil,
+			wantLink:  s3UsWest2.Link,
+		},
+		{
+			name:      "exact cloud+region match wins over same-cloud/other-region",
+			locations: []Location{s3UsWest2, s3UsEast1, gsUsEast1},
+			locator:   &fakeLocator{cloud: "s3", region: "us-east-1"},
+			wantLink:  s3UsEast1.Link,
+		},
+		{
+			name:      "same cloud, different region, used when no exact match",
+			locations: []Location{s3UsWest2, gsUsEast1},
+			locator:   &fakeLocator{cloud: "s3", region: "us-east-1"},
+			wantLink:  s3UsWest2.Link,
+		},
+		{
+			name:      "no cloud match falls back to the first location",
+			locations: []Location{gsUsEast1, s3UsWest2},
+			locator:   &fakeLocator{cloud: "azure", region: "us-east-1"},
+			wantLink:  gsUsEast1.Link,
+		},
+		{
+			name:      "Region error is tolerated, falling back to same-cloud match",
+			locations: []Location{s3UsWest2, s3UsEast1},
+			locator:   &fakeLocator{cloud: "s3", regionErr: errors.New("region unknown")},
+			wantLink:  s3UsWest2.Link,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var locator gps.Locator
+			if tt.locator != nil {
+				locator = tt.locator
+			}
+			got := selectLocation(context.Background(), tt.locations, locator)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("selectLocation() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("selectLocation() = nil, want Link %q", tt.wantLink)
+			}
+			if got.Link != tt.wantLink {
+				t.Errorf("selectLocation() Link = %q, want %q", got.Link, tt.wantLink)
+			}
+		})
+	}
+}